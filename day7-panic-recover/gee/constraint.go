@@ -0,0 +1,110 @@
+package gee
+
+import "sync"
+
+// constraint 限制参数片段能匹配的值，不满足时继续尝试其他路由
+type constraint struct {
+	expr  string // 规范化后的约束表达式，如 <int>、{[0-9]+}，用于判断两个参数是否等价
+	match func(string) bool
+}
+
+func (c *constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.expr
+}
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]func(string) bool{
+		"int":   isInt,
+		"uuid":  isUUID,
+		"slug":  isSlug,
+		"alpha": isAlpha,
+	}
+)
+
+// RegisterConstraint 注册命名约束，之后可以在路由中以 :id<name> 的形式使用。
+// 需要在注册用到它的路由之前调用。
+func RegisterConstraint(name string, match func(string) bool) {
+	if name == "" || match == nil {
+		panic("gee: constraint name and match function must not be empty")
+	}
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+	constraints[name] = match
+}
+
+func lookupConstraint(name string) (func(string) bool, bool) {
+	constraintsMu.RLock()
+	defer constraintsMu.RUnlock()
+	match, ok := constraints[name]
+	return match, ok
+}
+
+func isInt(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// isUUID 匹配 8-4-4-4-12 格式的十六进制 UUID
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isSlug 匹配由小写字母、数字和单个连字符组成的片段，如 hello-world-2
+func isSlug(s string) bool {
+	if s == "" || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-' && s[i-1] != '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,56 +1,245 @@
 package gee
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 type H map[string]interface{}
 
+// Param 是一个路由参数，由参数名和匹配到的值组成
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 是按路由中出现顺序排列的参数列表。
+// 用切片代替 map，路由查找时可以复用预分配的空间。
+type Params []Param
+
+// Get 返回第一个名为 name 的参数值
+func (ps Params) Get(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName 返回名为 name 的参数值，不存在时返回空字符串
+func (ps Params) ByName(name string) string {
+	value, _ := ps.Get(name)
+	return value
+}
+
+// unescape 原地解码参数值，无法解码的值保持不变
+func (ps Params) unescape() {
+	for i := range ps {
+		if !strings.Contains(ps[i].Value, "%") {
+			continue
+		}
+		if value, err := url.PathUnescape(ps[i].Value); err == nil {
+			ps[i].Value = value
+		}
+	}
+}
+
 type Context struct {
 	// origin objects
-	Writer http.ResponseWriter
+	Writer ResponseWriter
 	Req    *http.Request
 	// request info
 	Method string
 	Path   string
-	Params map[string]string
+	Params Params
 	// response info
+	writer responseWriter // Writer 指向它，随 Context 一起复用
+	// StatusCode 与 Writer.Status() 保持一致，只读，修改它不会改变响应的状态码。
+	//
+	// Deprecated: 使用 c.Writer.Status()。
 	StatusCode int
 	// middleware
 	handlers []HandlerFunc
 	index    int
+	route    *Route // 匹配到的路由，未匹配时为 nil
+	// Keys 是请求范围内的键值对，通过 Set 和 Get 读写，读写都加锁。
+	// 处理函数返回后 Context 会被复用，Keys 随之清空，
+	// 处理函数启动的 goroutine 如果可能在它返回后继续运行，必须使用 c.Copy() 的 Keys。
+	Keys map[string]interface{}
+	mu   sync.RWMutex
+	// Errors 是处理过程中通过 Error 或 AbortWithError 记录的错误，可以由外层中间件统一处理
+	Errors []error
 	// engine pointer
 	engine *Engine
 }
 
-func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
-		Writer: w,
-		Req:    req,
-		Method: req.Method,
-		Path:   req.URL.Path,
-		index:  -1,
+// reset 为新请求重置从池中取出的 Context，Params 保留已分配的空间
+func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
+	c.writer.mirror = &c.StatusCode
+	c.writer.reset(w)
+	c.Writer = &c.writer
+	c.Req = req
+	c.Method = req.Method
+	c.Path = req.URL.Path
+	c.Params = c.Params[:0]
+	c.handlers = nil
+	c.index = -1
+	c.route = nil
+	c.Errors = c.Errors[:0]
+	c.mu.Lock()
+	c.Keys = nil
+	c.mu.Unlock()
+}
+
+// Copy 返回可以在请求结束后继续使用的副本，如交给 goroutine 异步处理。
+// Context 会在请求结束后回收复用，因此不能把 c 本身留到处理函数返回之后。
+// 副本可以读取状态码，但不能调用 Next，写响应（包括设置响应头）会 panic。
+// 副本不会被复用，是可以安全地在处理函数之外作为 context.Context 使用的版本：
+// 它的 Done 和 Err 仍然跟随原请求的 Req.Context()，Value 读取复制时的 Keys。
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Req:        c.Req,
+		Method:     c.Method,
+		Path:       c.Path,
+		Params:     make(Params, len(c.Params)),
+		index:      abortIndex,
+		writer:     c.writer,
+		StatusCode: c.StatusCode,
+		route:      c.route,
+		engine:     c.engine,
 	}
+	cp.writer.ResponseWriter = copiedWriter{}
+	cp.writer.mirror = &cp.StatusCode
+	cp.Writer = &cp.writer
+	copy(cp.Params, c.Params)
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cp
 }
 
+// abortIndex 大于任何处理链的长度，index 达到它时 Next 不再调用后续处理函数
+const abortIndex = math.MaxInt / 2
+
+// Next 依次调用后续的处理函数。Engine.AbortOnCancel 为 true 时，
+// 请求的 context 被取消（如客户端断开连接）后中止处理链，不再调用剩余的处理函数。
 func (c *Context) Next() {
 	c.index++
 	s := len(c.handlers)
 	for ; c.index < s; c.index++ {
+		if c.engine.AbortOnCancel && c.Req.Context().Err() != nil {
+			c.Abort()
+			return
+		}
 		c.handlers[c.index](c)
 	}
 }
 
+// Context 实现了 context.Context，可以直接传给数据库驱动、HTTP 客户端等，
+// Deadline、Done 和 Err 使用 Req.Context()，Value 先查 Keys 再查 Req.Context()。
+//
+// c 只在处理函数返回前有效，之后会被回收给下一个请求，Req 和 Keys 随之改变。
+// 只能把 c 传给在处理函数返回前结束的调用；交给 goroutine、定时器、
+// 后台任务等可能活得更久的代码时，传 c.Copy() 或 c.Req.Context()。
+var _ context.Context = (*Context)(nil)
+
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value 在 key 为字符串且存在于 Keys 时返回 Keys 中的值，否则返回 Req.Context() 中的值
+func (c *Context) Value(key interface{}) interface{} {
+	if s, ok := key.(string); ok {
+		if value, exists := c.Get(s); exists {
+			return value
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
+}
+
+// Abort 阻止调用后续的处理函数，不影响当前处理函数的执行，也不写响应
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted 返回处理链是否已经中止
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus 中止处理链并立即写出状态码
+func (c *Context) AbortWithStatus(code int) {
+	c.Status(code)
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
+
+// AbortWithStatusJSON 中止处理链并以 JSON 返回 obj
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) {
+	c.Abort()
+	c.JSON(code, obj)
+}
+
+// AbortWithError 中止处理链、写出状态码并记录 err，返回 err 以便继续传递
+func (c *Context) AbortWithError(code int, err error) error {
+	c.AbortWithStatus(code)
+	return c.Error(err)
+}
+
+// Error 记录处理过程中的错误，返回 err 本身
+func (c *Context) Error(err error) error {
+	if err == nil {
+		panic("gee: err is nil")
+	}
+	c.Errors = append(c.Errors, err)
+	return err
+}
+
+// Fail 中止后续处理函数并返回错误信息，响应已经开始写出时只中止，不再追加内容
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
+	c.Abort()
+	if c.Writer.Written() {
+		return
+	}
 	c.JSON(code, H{"message": err})
 }
 
 func (c *Context) Param(key string) string {
-	value := c.Params[key]
-	return value
+	return c.Params.ByName(key)
 }
 
 func (c *Context) PostForm(key string) string {
@@ -61,8 +250,8 @@ func (c *Context) Query(key string) string {
 	return c.Req.URL.Query().Get(key)
 }
 
+// Status 设置状态码，响应头在第一次写响应体或请求结束时才写出
 func (c *Context) Status(code int) {
-	c.StatusCode = code
 	c.Writer.WriteHeader(code)
 }
 
@@ -77,12 +266,14 @@ func (c *Context) String(code int, format string, values ...interface{}) {
 }
 
 func (c *Context) JSON(code int, obj interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
-	c.Status(code)
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
+	c.SetHeader("Content-Type", "application/json")
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(obj); err != nil {
 		http.Error(c.Writer, err.Error(), 500)
+		return
 	}
+	c.Status(code)
+	c.Writer.Write(buf.Bytes())
 }
 
 func (c *Context) Data(code int, data []byte) {
@@ -93,9 +284,13 @@ func (c *Context) Data(code int, data []byte) {
 // HTML template render
 // refer https://golang.org/pkg/html/template/
 func (c *Context) HTML(code int, name string, data interface{}) {
-	c.SetHeader("Content-Type", "text/html")
-	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
+	// 先渲染到缓冲区，模板出错时不会留下写了一半的页面
+	var buf bytes.Buffer
+	if err := c.engine.htmlTemplates.ExecuteTemplate(&buf, name, data); err != nil {
 		c.Fail(500, err.Error())
+		return
 	}
+	c.SetHeader("Content-Type", "text/html")
+	c.Status(code)
+	c.Writer.Write(buf.Bytes())
 }
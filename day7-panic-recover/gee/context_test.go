@@ -0,0 +1,92 @@
+package gee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusCodeFollowsWriter(t *testing.T) {
+	engine := New()
+	var before, after, copied int
+	engine.Use(func(c *Context) {
+		c.Next()
+		after = c.StatusCode
+		copied = c.Copy().StatusCode
+	})
+	engine.GET("/created", func(c *Context) {
+		before = c.StatusCode
+		c.Writer.WriteHeader(http.StatusCreated)
+	})
+
+	w := performRequest(engine, http.MethodGet, "/created")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if before != http.StatusOK || after != http.StatusCreated || copied != http.StatusCreated {
+		t.Errorf("StatusCode before = %d, after = %d, copy = %d", before, after, copied)
+	}
+
+	performRequest(engine, http.MethodGet, "/missing")
+	if after != http.StatusNotFound {
+		t.Errorf("StatusCode for unmatched route = %d, want %d", after, http.StatusNotFound)
+	}
+}
+
+func TestCopyOutlivesRequestAsContext(t *testing.T) {
+	engine := New()
+	var ctx context.Context
+	engine.GET("/user/:id", func(c *Context) {
+		c.Set("user", c.Param("id"))
+		ctx = c.Copy()
+	})
+	engine.GET("/other/:id", func(c *Context) {
+		c.Set("user", c.Param("id"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/1", nil)
+	reqCtx, cancel := context.WithCancel(req.Context())
+	engine.ServeHTTP(httptest.NewRecorder(), req.WithContext(reqCtx))
+	// 下一个请求会复用同一个 Context
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other/2", nil))
+
+	if user := ctx.Value("user"); user != "1" {
+		t.Errorf(`copy Value("user") = %v, want "1"`, user)
+	}
+	cancel()
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("copy is not done after the request context was canceled")
+	}
+}
+
+func TestCopyRefusesToWrite(t *testing.T) {
+	engine := New()
+	var cp *Context
+	engine.GET("/", func(c *Context) {
+		cp = c.Copy()
+	})
+	performRequest(engine, http.MethodGet, "/")
+
+	writes := map[string]func(){
+		"String":    func() { cp.String(http.StatusOK, "hi") },
+		"JSON":      func() { cp.JSON(http.StatusOK, H{"a": 1}) },
+		"SetHeader": func() { cp.SetHeader("X-A", "1") },
+		"Write":     func() { cp.Writer.Write([]byte("hi")) },
+	}
+	for name, write := range writes {
+		func() {
+			defer func() {
+				if err := recover(); err != "gee: cannot write response from a copied Context" {
+					t.Errorf("%s on a copy: recovered %v", name, err)
+				}
+			}()
+			write()
+		}()
+	}
+	if cp.Writer.Status() != http.StatusOK {
+		t.Errorf("copy Writer.Status() = %d, want %d", cp.Writer.Status(), http.StatusOK)
+	}
+}
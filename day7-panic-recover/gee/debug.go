@@ -0,0 +1,43 @@
+package gee
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var routesTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Routes</title></head>
+<body>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Method</th><th>Host</th><th>Pattern</th><th>Name</th><th>Handler</th><th>Middlewares</th><th>Group</th><th>Summary</th><th>Tags</th></tr>
+{{range .}}<tr><td>{{.Method}}</td><td>{{.Host}}</td><td>{{.Pattern}}</td><td>{{.Name}}</td><td>{{.HandlerName}}</td><td>{{range .Middlewares}}{{.}}<br>{{end}}</td><td>{{.Group}}</td><td>{{if .Deprecated}}<s>{{.Summary}}</s> (deprecated){{else}}{{.Summary}}{{end}}</td><td>{{range .Tags}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// RoutesHandler 返回展示路由表的处理函数，可以挂载到任意路径，如
+//
+//	r.GET("/debug/routes", r.RoutesHandler())
+//
+// 请求带 ?format=json 或 Accept: application/json 时返回 JSON，否则返回 HTML 表格。
+func (engine *Engine) RoutesHandler() HandlerFunc {
+	return func(c *Context) {
+		routes := engine.Routes()
+		if c.Query("format") == "json" || strings.Contains(c.Req.Header.Get("Accept"), "application/json") {
+			c.JSON(http.StatusOK, routes)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := routesTemplate.Execute(&buf, routes); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.SetHeader("Content-Type", "text/html; charset=utf-8")
+		c.Data(http.StatusOK, buf.Bytes())
+	}
+}
@@ -3,8 +3,11 @@ package gee
 import (
 	"log"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 )
 
@@ -13,6 +16,7 @@ type HandlerFunc func(c *Context)
 type (
 	RouterGroup struct {
 		prefix      string
+		host        *hostPattern // 为 nil 表示不限 host
 		middlewares []HandlerFunc
 		parent      *RouterGroup
 		engine      *Engine
@@ -20,16 +24,45 @@ type (
 	Engine struct {
 		*RouterGroup
 		router        *router
-		groups        []*RouterGroup
 		htmlTemplates *template.Template
 		funcMap       template.FuncMap
+		noRoute       []HandlerFunc
+		noMethod      []HandlerFunc
+		pool          sync.Pool // 复用 Context
+
+		// HandleMethodNotAllowed 为 true 时，路径存在但方法不匹配的请求返回 405 并带上 Allow 头
+		HandleMethodNotAllowed bool
+		// HandleOPTIONS 为 true 时，没有显式注册的 OPTIONS 请求自动返回该路径允许的方法
+		HandleOPTIONS bool
+		// RedirectTrailingSlash 为 true 时，/foo/ 未注册而 /foo 已注册（或反之）的请求会跳转到已注册的路径
+		RedirectTrailingSlash bool
+		// RedirectFixedPath 为 true 时，未匹配的路径会先去掉 .. 和重复的 /，再忽略大小写查找，找到后跳转过去
+		RedirectFixedPath bool
+		// StrictRouting 为 true 时只做精确匹配，忽略上面两个跳转选项
+		StrictRouting bool
+		// UseRawPath 为 true 时按请求的原始路径匹配路由，参数值中的 %2F 不会被当作分隔符
+		UseRawPath bool
+		// UnescapePathValues 为 true 时对 UseRawPath 匹配到的参数值完全解码，否则参数值中保留 %2F 和 %25
+		UnescapePathValues bool
+		// AbortOnCancel 为 true 时，请求的 context 被取消后 Context.Next 不再调用剩余的处理函数
+		AbortOnCancel bool
+		// NewRouter 创建匹配路由用的 Router，为 nil 时使用 NewTrieRouter。
+		// 自定义的 Router 不支持 RedirectFixedPath 中忽略大小写的查找。
+		NewRouter func() Router
 	}
 )
 
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		HandleMethodNotAllowed: true,
+		RedirectTrailingSlash:  true,
+		UnescapePathValues:     true,
+	}
+	engine.router = newRouter(engine)
+	engine.pool.New = func() interface{} {
+		return &Context{engine: engine}
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
-	engine.groups = []*RouterGroup{engine.RouterGroup}
 	return engine
 }
 
@@ -42,33 +75,156 @@ func Default() *Engine {
 	return engine
 }
 
+// NoRoute 设置没有匹配路由时执行的处理函数，它们在全局中间件之后执行，
+// 执行前状态码已经设为 404，可以用 c.Status 修改；不传参数时恢复默认的纯文本 404
+func (engine *Engine) NoRoute(handlers ...HandlerFunc) {
+	engine.router.update(func() {
+		engine.noRoute = handlers
+	})
+}
+
+// NoMethod 设置路径存在但方法不匹配时执行的处理函数，执行前已经写好 Allow 头并把状态码设为 405，
+// 只在 HandleMethodNotAllowed 为 true 时生效；不传参数时恢复默认的纯文本 405
+func (engine *Engine) NoMethod(handlers ...HandlerFunc) {
+	engine.router.update(func() {
+		engine.noMethod = handlers
+	})
+}
+
 func (group *RouterGroup) Group(prefix string) *RouterGroup {
 	engine := group.engine
 	newGroup := &RouterGroup{
 		prefix: group.prefix + prefix,
+		host:   group.host,
 		parent: group,
 		engine: engine,
 	}
-	engine.groups = append(engine.groups, newGroup)
 	return newGroup
 }
 
+// Host 返回只处理指定 host 的分组，host 中的 {name} 会捕获对应的一级域名，
+// 可以通过 c.Param("name") 读取。请求先按 Host 头选择分组，再匹配路径，
+// 限定 host 的路由优先于不限 host 的路由。
+//
+//	api := r.Host("api.example.com")
+//	tenant := r.Host("{tenant}.example.com")
+func (group *RouterGroup) Host(host string) *RouterGroup {
+	engine := group.engine
+	newGroup := &RouterGroup{
+		prefix: group.prefix,
+		host:   parseHost(host),
+		parent: group,
+		engine: engine,
+	}
+	return newGroup
+}
+
+// Use 为分组添加中间件，对分组及其子分组中的所有路由生效，包括在 Use 之前注册的路由
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
-	group.middlewares = append(group.middlewares, middlewares...)
+	group.engine.router.update(func() {
+		group.middlewares = append(group.middlewares, middlewares...)
+	})
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+// combineHandlers 按 根分组 -> 父分组 -> group 的顺序拼接中间件，最后接上 handlers
+func (group *RouterGroup) combineHandlers(handlers []HandlerFunc) []HandlerFunc {
+	groups := make([]*RouterGroup, 0)
+	size := len(handlers)
+	for g := group; g != nil; g = g.parent {
+		groups = append(groups, g)
+		size += len(g.middlewares)
+	}
+	chain := make([]HandlerFunc, 0, size)
+	for i := len(groups) - 1; i >= 0; i-- {
+		chain = append(chain, groups[i].middlewares...)
+	}
+	return append(chain, handlers...)
+}
+
+// addRoute 注册路由，handlers 依次执行，排在分组中间件之后
+func (group *RouterGroup) addRoute(method string, comp string, handlers []HandlerFunc) *Route {
+	if len(handlers) == 0 {
+		panic("gee: route " + method + " " + group.prefix + comp + " has no handler")
+	}
 	pattern := group.prefix + comp
-	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	if group.host != nil {
+		log.Printf("Route %4s - %s%s", method, group.host.raw, pattern)
+	} else {
+		log.Printf("Route %4s - %s", method, pattern)
+	}
+	route := &Route{method: method, pattern: pattern, handlers: handlers, group: group}
+	group.engine.router.addRoute(route)
+	return route
+}
+
+// RemoveRoute 删除分组中以 method 注册的 pattern 路由，返回是否找到。
+// 与注册路由一样可以在处理请求期间调用，正在处理的请求不受影响。
+func (group *RouterGroup) RemoveRoute(method string, pattern string) bool {
+	pattern = group.prefix + pattern
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	return group.engine.router.removeRoute(method, pattern, group.host)
+}
+
+// anyMethods 是 Any 注册时使用的全部标准 HTTP 方法
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+	http.MethodConnect, http.MethodTrace,
+}
+
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("GET", pattern, handlers)
+}
+
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("POST", pattern, handlers)
 }
 
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("PUT", pattern, handlers)
 }
 
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("PATCH", pattern, handlers)
+}
+
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("DELETE", pattern, handlers)
+}
+
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("HEAD", pattern, handlers)
+}
+
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("OPTIONS", pattern, handlers)
+}
+
+// Handle 以任意方法注册路由，可用于 WebDAV 等自定义方法
+func (group *RouterGroup) Handle(method string, pattern string, handlers ...HandlerFunc) *Route {
+	if method == "" || strings.ContainsAny(method, " \t\r\n") {
+		panic("gee: invalid http method " + strconv.Quote(method))
+	}
+	return group.addRoute(method, pattern, handlers)
+}
+
+// Match 为 methods 中的每个方法注册同一组处理函数
+func (group *RouterGroup) Match(methods []string, pattern string, handlers ...HandlerFunc) []*Route {
+	routes := make([]*Route, 0, len(methods))
+	for _, method := range methods {
+		routes = append(routes, group.Handle(method, pattern, handlers...))
+	}
+	return routes
+}
+
+// Any 为所有标准 HTTP 方法注册同一组处理函数
+func (group *RouterGroup) Any(pattern string, handlers ...HandlerFunc) []*Route {
+	return group.Match(anyMethods, pattern, handlers...)
 }
 
 func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
@@ -86,16 +242,66 @@ func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileS
 
 func (group *RouterGroup) Static(relativePath string, root string) {
 	handler := group.createStaticHandler(relativePath, http.Dir(root))
-	urlPattern := path.Join(relativePath, "filepath")
+	urlPattern := path.Join(relativePath, "/*filepath")
 	group.GET(urlPattern, handler)
 }
 
+// WrapH 把 http.Handler 转换为 HandlerFunc，便于在路由和中间件链中使用
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// WrapF 把 http.HandlerFunc 转换为 HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Req)
+	}
+}
+
+// Mount 把 h 挂载到 prefix 下，所有方法的 prefix 及其子路径都交给 h 处理。
+// 转发前去掉请求路径中的前缀，所以 h 看到的是相对路径，可以是另一个 Engine 或
+// pprof 之类的 http.Handler；分组的中间件会在 h 之前执行。
+//
+//	r.Group("/admin").Mount("/ui", adminUI) // /admin/ui/users -> adminUI 收到 /users
+func (group *RouterGroup) Mount(prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	absolutePath := group.prefix + prefix
+	handler := func(c *Context) {
+		req := new(http.Request)
+		*req = *c.Req
+		req.URL = new(url.URL)
+		*req.URL = *c.Req.URL
+		req.URL.Path = strings.TrimPrefix(c.Req.URL.Path, absolutePath)
+		if req.URL.Path == "" {
+			req.URL.Path = "/"
+		}
+		if rawPath := c.Req.URL.RawPath; rawPath != "" {
+			req.URL.RawPath = strings.TrimPrefix(rawPath, absolutePath)
+			if req.URL.RawPath == rawPath {
+				req.URL.RawPath = ""
+			}
+		}
+		h.ServeHTTP(c.Writer, req)
+	}
+
+	if absolutePath != "" {
+		group.Any(prefix, handler)
+	}
+	group.Any(prefix+"/", handler)
+	group.Any(prefix+"/*path", handler)
+}
+
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
 }
 
+// LoadHTMLGlob 加载模板，模板中可以用 {{url "name" "key" value}} 生成命名路由的 URL，
+// SetFuncMap 中的同名函数会覆盖它
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	funcMap := template.FuncMap{"url": engine.URL}
+	engine.htmlTemplates = template.Must(template.New("").Funcs(funcMap).Funcs(engine.funcMap).ParseGlob(pattern))
 }
 
 func (engine *Engine) Run(addr string) (err error) {
@@ -103,15 +309,9 @@ func (engine *Engine) Run(addr string) (err error) {
 }
 
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var middlewares []HandlerFunc
-	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
-		}
-	}
-
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine
+	c := engine.pool.Get().(*Context)
+	c.reset(w, req)
 	engine.router.handle(c)
+	c.Writer.WriteHeaderNow()
+	engine.pool.Put(c)
 }
@@ -0,0 +1,105 @@
+package gee
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hostPattern 是按 . 拆分的 host 模式，{name} 捕获对应的一级域名并写入 Params，
+// 如 {tenant}.example.com 匹配 acme.example.com，得到 tenant=acme
+type hostPattern struct {
+	raw      string
+	labels   []string
+	wildcard bool // 是否包含 {name}
+}
+
+func (h *hostPattern) String() string {
+	if h == nil {
+		return ""
+	}
+	return h.raw
+}
+
+func parseHost(host string) *hostPattern {
+	host = strings.ToLower(host)
+	if host == "" || strings.ContainsAny(host, "/:") {
+		panic(fmt.Sprintf("gee: invalid host pattern '%s'", host))
+	}
+	h := &hostPattern{raw: host, labels: strings.Split(host, ".")}
+	for _, label := range h.labels {
+		if label == "" {
+			panic(fmt.Sprintf("gee: empty label in host pattern '%s'", host))
+		}
+		if label[0] == '{' {
+			if len(label) < 3 || label[len(label)-1] != '}' {
+				panic(fmt.Sprintf("gee: invalid label '%s' in host pattern '%s'", label, host))
+			}
+			h.wildcard = true
+		}
+	}
+	return h
+}
+
+// stripPort 去掉 Host 头中的端口，支持 [::1]:8080 形式的 IPv6 地址
+func stripPort(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if i := strings.IndexByte(host, ']'); i >= 0 {
+			return host[:i+1]
+		}
+		return host
+	}
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		return host[:i]
+	}
+	return host
+}
+
+// match 判断 host 是否匹配，捕获的值追加到 params；params 为 nil 时只做判断。
+// 不匹配时 params 保持不变。
+func (h *hostPattern) match(host string, params *Params) bool {
+	host = stripPort(host)
+	if strings.Count(host, ".") != len(h.labels)-1 {
+		return false
+	}
+	mark := 0
+	if params != nil {
+		mark = len(*params)
+	}
+	for _, label := range h.labels {
+		value := host
+		if end := strings.IndexByte(host, '.'); end >= 0 {
+			value, host = host[:end], host[end+1:]
+		}
+
+		if label[0] != '{' {
+			if !strings.EqualFold(label, value) {
+				if params != nil {
+					*params = (*params)[:mark]
+				}
+				return false
+			}
+			continue
+		}
+		if value == "" {
+			if params != nil {
+				*params = (*params)[:mark]
+			}
+			return false
+		}
+		if params != nil {
+			*params = append(*params, Param{Key: label[1 : len(label)-1], Value: value})
+		}
+	}
+	return true
+}
+
+// captures 返回 host 模式中捕获参数的个数
+func (h *hostPattern) captures() int {
+	count := 0
+	for _, label := range h.labels {
+		if label[0] == '{' {
+			count++
+		}
+	}
+	return count
+}
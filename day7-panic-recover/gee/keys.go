@@ -0,0 +1,92 @@
+package gee
+
+import (
+	"fmt"
+	"time"
+)
+
+// Set 在请求范围内保存 key 对应的值，如中间件保存已认证的用户，供后续处理函数读取
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+}
+
+// Get 返回 key 对应的值以及是否存在
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists = c.Keys[key]
+	return
+}
+
+// MustGet 返回 key 对应的值，不存在时 panic
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic(fmt.Sprintf("gee: key '%s' does not exist", key))
+}
+
+// Value 返回 key 对应的 T 类型的值，不存在或类型不符时返回零值和 false
+//
+//	user, ok := gee.Value[*User](c, "user")
+func Value[T any](c *Context, key string) (T, bool) {
+	value, _ := c.Get(key)
+	v, ok := value.(T)
+	return v, ok
+}
+
+// GetString 等方法返回 key 对应的指定类型的值，不存在或类型不符时返回零值
+func (c *Context) GetString(key string) string {
+	v, _ := Value[string](c, key)
+	return v
+}
+
+func (c *Context) GetBool(key string) bool {
+	v, _ := Value[bool](c, key)
+	return v
+}
+
+func (c *Context) GetInt(key string) int {
+	v, _ := Value[int](c, key)
+	return v
+}
+
+func (c *Context) GetInt64(key string) int64 {
+	v, _ := Value[int64](c, key)
+	return v
+}
+
+func (c *Context) GetUint(key string) uint {
+	v, _ := Value[uint](c, key)
+	return v
+}
+
+func (c *Context) GetFloat64(key string) float64 {
+	v, _ := Value[float64](c, key)
+	return v
+}
+
+func (c *Context) GetTime(key string) time.Time {
+	v, _ := Value[time.Time](c, key)
+	return v
+}
+
+func (c *Context) GetDuration(key string) time.Duration {
+	v, _ := Value[time.Duration](c, key)
+	return v
+}
+
+func (c *Context) GetStringSlice(key string) []string {
+	v, _ := Value[[]string](c, key)
+	return v
+}
+
+func (c *Context) GetStringMap(key string) map[string]interface{} {
+	v, _ := Value[map[string]interface{}](c, key)
+	return v
+}
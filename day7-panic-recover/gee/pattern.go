@@ -0,0 +1,177 @@
+package gee
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// wildcard 是解析后的参数或通配片段，支持以下写法：
+//
+//	:id  :id<int>  {id}  {id:[0-9]+}  *filepath
+//	:name.png  {name}.png   参数后可以跟固定后缀，匹配时去掉后缀
+//	:lang?  :id<int>?       以 ? 结尾表示可选，注册时展开为带和不带该片段的两条路由
+type wildcard struct {
+	name       string
+	constraint *constraint
+	suffix     string
+	optional   bool
+}
+
+// isWild 判断片段是否为参数或通配片段
+func isWild(part string) bool {
+	return part[0] == ':' || part[0] == '*' || part[0] == '{'
+}
+
+// parsePattern 将路由拆分为静态片段与通配片段，
+// 如 /user/{id:[0-9]+}/*filepath -> ["/user/", "{id:[0-9]+}", "/", "*filepath"]
+func parsePattern(pattern string) []string {
+	parts := make([]string, 0)
+	start := 0
+	for i := 1; i < len(pattern); i++ {
+		if pattern[i-1] != '/' || !isWild(pattern[i:]) {
+			continue
+		}
+		if start < i {
+			parts = append(parts, pattern[start:i])
+		}
+		end := wildEnd(pattern, i)
+		parts = append(parts, pattern[i:end])
+		start, i = end, end
+	}
+	if start < len(pattern) {
+		parts = append(parts, pattern[start:])
+	}
+	return parts
+}
+
+// wildEnd 返回从 i 开始的通配片段的结束位置，{...} 中的正则可以包含嵌套的花括号和 /
+func wildEnd(pattern string, i int) int {
+	j := i
+	if pattern[i] == '{' {
+		depth := 0
+		for ; j < len(pattern); j++ {
+			if pattern[j] == '{' {
+				depth++
+			} else if pattern[j] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if j == len(pattern) {
+			panic(fmt.Sprintf("gee: unterminated '{' in route '%s'", pattern))
+		}
+	}
+	if end := strings.IndexByte(pattern[j:], '/'); end >= 0 {
+		return j + end
+	}
+	return len(pattern)
+}
+
+// parseWild 解析通配片段，约束和正则在这里编译
+func parseWild(pattern string, part string) wildcard {
+	var w wildcard
+	if part[0] != '*' && part[len(part)-1] == '?' {
+		w.optional = true
+		part = part[:len(part)-1]
+	}
+
+	switch part[0] {
+	case '*':
+		w.name = part[1:]
+	case '{':
+		end := strings.LastIndexByte(part, '}')
+		body := part[1:end]
+		w.suffix = part[end+1:]
+		i := strings.IndexByte(body, ':')
+		if i < 0 {
+			w.name = body
+			break
+		}
+		re, err := regexp.Compile("^(?:" + body[i+1:] + ")$")
+		if err != nil {
+			panic(fmt.Sprintf("gee: invalid constraint in route '%s': %v", pattern, err))
+		}
+		w.name = body[:i]
+		w.constraint = &constraint{expr: "{" + body[i+1:] + "}", match: re.MatchString}
+	default:
+		i := strings.IndexByte(part, '<')
+		if i < 0 {
+			w.name = part[1:]
+			if dot := strings.IndexByte(w.name, '.'); dot >= 0 {
+				w.name, w.suffix = w.name[:dot], w.name[dot:]
+			}
+			break
+		}
+		end := strings.IndexByte(part, '>')
+		if end < 0 {
+			panic(fmt.Sprintf("gee: unterminated constraint '%s' in route '%s'", part, pattern))
+		}
+		name := part[i+1 : end]
+		match, ok := lookupConstraint(name)
+		if !ok {
+			panic(fmt.Sprintf("gee: unknown constraint '%s' in route '%s'", name, pattern))
+		}
+		w.name = part[1:i]
+		w.suffix = part[end+1:]
+		w.constraint = &constraint{expr: "<" + name + ">", match: match}
+	}
+	return w
+}
+
+// validatePattern 检查通配符是否命名，只有位于最后一段的 catch-all 可以省略名称
+func validatePattern(pattern string, parts []string) {
+	for i, part := range parts {
+		if !isWild(part) || part[0] == '*' && i == len(parts)-1 {
+			continue
+		}
+		if parseWild(pattern, part).name == "" {
+			panic(fmt.Sprintf("gee: wildcard in route '%s' must be named", pattern))
+		}
+	}
+}
+
+// expandOptional 展开可选片段，返回所有组合，第一项包含全部片段。
+// 去掉可选片段时一并去掉它前面的 /，如 /docs/:lang?/intro -> /docs/:lang/intro 和 /docs/intro
+func expandOptional(pattern string, parts []string) [][]string {
+	variants := [][]string{{}}
+	for _, part := range parts {
+		optional := isWild(part) && parseWild(pattern, part).optional
+		next := make([][]string, 0, len(variants)*2)
+		for _, v := range variants {
+			if !optional {
+				next = append(next, append(v[:len(v):len(v)], part))
+				continue
+			}
+			next = append(next, append(v[:len(v):len(v)], part[:len(part)-1]))
+			without := append([]string(nil), v...)
+			if last := len(without) - 1; last >= 0 && !isWild(without[last]) {
+				without[last] = strings.TrimSuffix(without[last], "/")
+				if without[last] == "" {
+					without = without[:last]
+				}
+			}
+			next = append(next, without)
+		}
+		variants = next
+	}
+
+	for i, v := range variants {
+		// 合并相邻的静态片段，并保证以 / 开头
+		merged := make([]string, 0, len(v))
+		for _, part := range v {
+			if n := len(merged); n > 0 && !isWild(part) && !isWild(merged[n-1]) {
+				merged[n-1] += part
+				continue
+			}
+			merged = append(merged, part)
+		}
+		if len(merged) == 0 || isWild(merged[0]) || merged[0][0] != '/' {
+			merged = append([]string{"/"}, merged...)
+		}
+		variants[i] = merged
+	}
+	return variants
+}
@@ -0,0 +1,130 @@
+package gee
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+const noWritten = -1
+
+// ResponseWriter 包装 http.ResponseWriter，推迟写响应头直到第一次写响应体（或请求结束），
+// 并记录状态码和已写入的字节数。底层 writer 不支持 Flush、Hijack 或 Push 时，
+// 对应方法分别为空操作、返回错误、返回 http.ErrNotSupported。
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+
+	// Status 返回响应的状态码，未设置时为 200
+	Status() int
+	// Size 返回已写入的响应体字节数，响应头未写出时为 -1
+	Size() int
+	// Written 返回响应头是否已经写出，写出后不能再修改状态码和响应头
+	Written() bool
+	// WriteHeaderNow 立即写出响应头
+	WriteHeaderNow()
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+	mirror *int // 指向 Context.StatusCode，状态码变化时同步更新
+}
+
+var _ ResponseWriter = (*responseWriter)(nil)
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.size = noWritten
+	w.setStatus(http.StatusOK)
+}
+
+func (w *responseWriter) setStatus(code int) {
+	w.status = code
+	if w.mirror != nil {
+		*w.mirror = code
+	}
+}
+
+// WriteHeader 只记录状态码，响应头写出后再调用不生效
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.setStatus(code)
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 接管连接，之后不再通过 w 写响应
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("gee: response writer does not implement http.Hijacker")
+	}
+	if !w.Written() {
+		w.size = 0
+	}
+	return h.Hijack()
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap 返回底层的 http.ResponseWriter，供 http.ResponseController 使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// copiedWriter 是 Context.Copy 返回的副本使用的底层 writer，副本不能写响应，任何写操作都会 panic
+type copiedWriter struct{}
+
+func (copiedWriter) Header() http.Header {
+	panic("gee: cannot write response from a copied Context")
+}
+
+func (copiedWriter) Write([]byte) (int, error) {
+	panic("gee: cannot write response from a copied Context")
+}
+
+func (copiedWriter) WriteHeader(int) {
+	panic("gee: cannot write response from a copied Context")
+}
@@ -0,0 +1,223 @@
+package gee
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Route 是一条已注册的路由，由 GET、POST 等方法返回，可以链式设置名称、描述、标签等元数据，
+// 处理请求时通过 Context.Route 读取
+type Route struct {
+	method     string
+	pattern    string
+	handlers   []HandlerFunc // 路由自身的处理函数，最后一个是主处理函数，前面的是单路由中间件
+	chain      []HandlerFunc // 分组中间件 + handlers，发布路由快照时计算，请求时直接使用
+	name       string
+	summary    string
+	tags       []string
+	deprecated bool
+	meta       map[string]interface{} // 修改时整体替换，快照中的副本可以安全地共享
+	group      *RouterGroup
+	info       RouteInfo // 发布路由快照时计算，Context.Route 直接返回
+}
+
+// RouteInfo 描述一条已注册的路由，由 Engine.Routes 返回
+type RouteInfo struct {
+	Method      string                 `json:"method"`
+	Host        string                 `json:"host,omitempty"`
+	Pattern     string                 `json:"pattern"`
+	Name        string                 `json:"name,omitempty"`
+	HandlerName string                 `json:"handler"`
+	Middlewares []string               `json:"middlewares"` // 依次生效的分组中间件和单路由中间件
+	Group       string                 `json:"group"`       // 所在分组的前缀
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Meta        map[string]interface{} `json:"meta,omitempty"` // 只读，与路由共享
+}
+
+// Routes 返回当前路由快照中 Router.Routes 的结果，内置的 Router 按注册顺序返回所有路由
+func (engine *Engine) Routes() []RouteInfo {
+	return engine.router.load().router.Routes()
+}
+
+// describe 根据处理链生成 RouteInfo，需要先计算 chain
+func (route *Route) describe() RouteInfo {
+	last := len(route.chain) - 1
+	middlewares := make([]string, 0, last)
+	for _, middleware := range route.chain[:last] {
+		middlewares = append(middlewares, nameOfFunction(middleware))
+	}
+	host := ""
+	if route.group.host != nil {
+		host = route.group.host.raw
+	}
+	return RouteInfo{
+		Method:      route.method,
+		Host:        host,
+		Pattern:     route.pattern,
+		Name:        route.name,
+		HandlerName: nameOfFunction(route.chain[last]),
+		Middlewares: middlewares,
+		Group:       route.group.prefix,
+		Summary:     route.summary,
+		Tags:        route.tags,
+		Deprecated:  route.deprecated,
+		Meta:        route.meta,
+	}
+}
+
+// Method 返回路由的 HTTP 方法
+func (route *Route) Method() string {
+	return route.method
+}
+
+// Pattern 返回注册时的路由模式，包含分组前缀
+func (route *Route) Pattern() string {
+	return route.pattern
+}
+
+// Host 返回路由限定的 host 模式，不限 host 时为空
+func (route *Route) Host() string {
+	return route.group.host.String()
+}
+
+// Handlers 返回完整的处理链，只有交给 Router 的路由才会计算
+func (route *Route) Handlers() []HandlerFunc {
+	return route.chain
+}
+
+// nameOfFunction 返回函数的完整名称，如 main.main.func1
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+// Name 为路由命名，之后可以用 Engine.URL 或模板函数 url 反向生成路径
+func (route *Route) Name(name string) *Route {
+	route.group.engine.router.setName(route, name)
+	return route
+}
+
+// Summary 设置路由的简要描述
+func (route *Route) Summary(summary string) *Route {
+	route.group.engine.router.update(func() {
+		route.summary = summary
+	})
+	return route
+}
+
+// Tags 为路由追加标签，如 Tags("user", "admin")
+func (route *Route) Tags(tags ...string) *Route {
+	route.group.engine.router.update(func() {
+		route.tags = append(route.tags[:len(route.tags):len(route.tags)], tags...)
+	})
+	return route
+}
+
+// Deprecated 标记路由已废弃
+func (route *Route) Deprecated() *Route {
+	route.group.engine.router.update(func() {
+		route.deprecated = true
+	})
+	return route
+}
+
+// Meta 为路由设置任意属性，供中间件按路由做鉴权、限流等决策
+func (route *Route) Meta(key string, value interface{}) *Route {
+	route.group.engine.router.update(func() {
+		meta := make(map[string]interface{}, len(route.meta)+1)
+		for k, v := range route.meta {
+			meta[k] = v
+		}
+		meta[key] = value
+		route.meta = meta
+	})
+	return route
+}
+
+// Route 返回当前请求匹配到的路由，未匹配（如 404、405 和自动跳转）时返回零值。
+// RouteInfo 在发布路由快照时已经算好，调用不分配内存，其中的切片和 map 不能修改。
+func (c *Context) Route() RouteInfo {
+	if c.route == nil {
+		return RouteInfo{}
+	}
+	return c.route.info
+}
+
+// URL 根据命名路由生成路径。pairs 依次为参数名和参数值，
+// 路由中的 :param 和 *catchall 用对应的值填充并转义，其余参数追加为查询字符串。
+//
+//	engine.GET("/user/:id/*file", h).Name("file")
+//	engine.URL("file", "id", 1, "file", "a b/c.txt", "v", 2) // /user/1/a%20b/c.txt?v=2
+func (engine *Engine) URL(name string, pairs ...interface{}) (string, error) {
+	route, ok := engine.router.load().names[name]
+	if !ok {
+		return "", fmt.Errorf("gee: no route named '%s'", name)
+	}
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("gee: odd number of parameters for route '%s'", name)
+	}
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("gee: parameter name %v for route '%s' is not a string", pairs[i], name)
+		}
+		values[key] = fmt.Sprint(pairs[i+1])
+	}
+
+	buf := make([]byte, 0, len(route.pattern))
+	for _, part := range parsePattern(route.pattern) {
+		if !isWild(part) {
+			buf = append(buf, part...)
+			continue
+		}
+		w := parseWild(route.pattern, part)
+		value, ok := values[w.name]
+		if !ok || value == "" {
+			if !w.optional {
+				return "", fmt.Errorf("gee: missing parameter '%s' for route '%s'", w.name, name)
+			}
+			// 省略可选片段时一并去掉它前面的 /
+			if n := len(buf); n > 0 && buf[n-1] == '/' {
+				buf = buf[:n-1]
+			}
+			continue
+		}
+		delete(values, w.name)
+		if part[0] != '*' {
+			if w.constraint != nil && !w.constraint.match(value) {
+				return "", fmt.Errorf("gee: parameter '%s' of route '%s' does not match %s", w.name, name, w.constraint)
+			}
+			buf = append(buf, url.PathEscape(value)...)
+			buf = append(buf, w.suffix...)
+			continue
+		}
+		segments := strings.Split(value, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		buf = append(buf, strings.Join(segments, "/")...)
+	}
+	if len(buf) == 0 {
+		buf = append(buf, '/')
+	}
+
+	if len(values) > 0 {
+		query := make(url.Values, len(values))
+		for key, value := range values {
+			query.Set(key, value)
+		}
+		buf = append(buf, '?')
+		buf = append(buf, query.Encode()...)
+	}
+	return string(buf), nil
+}
+
+// URLFor 与 Engine.URL 相同，方便在处理函数中生成跳转地址
+func (c *Context) URLFor(name string, pairs ...interface{}) (string, error) {
+	return c.engine.URL(name, pairs...)
+}
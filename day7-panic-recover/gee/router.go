@@ -1,97 +1,391 @@
 package gee
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// Router 是可替换的路由匹配实现，通过 Engine.NewRouter 提供，默认使用内置的前缀树（NewTrieRouter）。
+// Engine 每次发布路由快照时新建一个 Router，按注册顺序 Add 所有路由，之后只会并发调用 Lookup，不再修改。
+type Router interface {
+	// Add 注册路由，route 的处理链已经接好分组中间件。不支持的模式应直接 panic，
+	// 这会发生在路由变化后第一次处理请求时。
+	Add(route *Route)
+	// Lookup 返回 host 和 path 匹配的路由，必须是 Add 传入的 *Route，未匹配时返回 nil。
+	// 参数追加到 params 后返回，params 预留了所有路由中参数个数的最大值。
+	Lookup(method string, host string, path string, params Params) (*Route, Params)
+	// Routes 按注册顺序返回所有路由
+	Routes() []RouteInfo
+}
+
+// routeTable 是一份路由快照。router 在锁内修改自己的 table，处理请求时读取 publish 发布的快照，
+// 快照发布后不再修改，因此无需加锁。
+type routeTable struct {
+	router    Router            // 匹配路由用的 Router，由 Engine.NewRouter 创建
+	methods   []string          // 注册过路由的方法，按字母序排列，用于计算 Allow
+	names     map[string]*Route // 命名路由，用于反向生成 URL
+	maxParams int               // 所有路由中通配符数量的最大值，用于预分配 Params
+	global    []HandlerFunc     // 全局中间件，用于跳转、OPTIONS 等内置响应
+	noRoute   []HandlerFunc     // 全局中间件 + NoRoute 处理函数
+	noMethod  []HandlerFunc     // 全局中间件 + NoMethod 处理函数
+}
+
 type router struct {
-	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	engine *Engine
+	mu     sync.Mutex                 // 保护以下字段以及分组的中间件
+	table  *trie                      // 正在编辑的路由树，用于在注册时发现冲突
+	routes []*Route                   // 按注册顺序保存的全部路由
+	names  map[string]*Route          // 命名路由
+	snap   atomic.Pointer[routeTable] // 供请求读取的快照，路由变化后置空，下次读取时重新发布
 }
 
-func newRouter() *router {
+func newRouter(engine *Engine) *router {
 	return &router{
-		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+		engine: engine,
+		table:  newTrie(),
+		names:  make(map[string]*Route),
 	}
 }
 
-func parsePattern(pattern string) []string {
-	vs := strings.Split(pattern, "/")
-	parts := make([]string, 0)
-	for _, item := range vs {
-		if item != "" {
-			parts = append(parts, item)
-			if item[0] == '*' {
-				break
-			}
+// update 在锁内修改路由，结束后让快照失效。f 中 panic 时已注册的路由不受影响。
+func (r *router) update(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.snap.Store(nil)
+	f()
+}
+
+// load 返回当前的路由快照，路由变化后的第一次读取会重新发布
+func (r *router) load() *routeTable {
+	if t := r.snap.Load(); t != nil {
+		return t
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.snap.Load(); t != nil {
+		return t
+	}
+	t := r.publish()
+	r.snap.Store(t)
+	return t
+}
+
+// publish 复制所有路由并计算完整的处理链和 RouteInfo，交给新建的 Router，
+// 同时计算 404/405 的处理链，调用方需持有锁
+func (r *router) publish() *routeTable {
+	engine := r.engine
+	newRouter := engine.NewRouter
+	if newRouter == nil {
+		newRouter = NewTrieRouter
+	}
+	t := &routeTable{
+		router:    newRouter(),
+		names:     make(map[string]*Route, len(r.names)),
+		maxParams: r.table.maxParams,
+	}
+	routes := make(map[*Route]*Route, len(r.routes))
+	for _, route := range r.routes {
+		cp := *route
+		cp.chain = cp.group.combineHandlers(cp.handlers)
+		cp.info = cp.describe()
+		routes[route] = &cp
+		t.router.Add(&cp)
+		if !slices.Contains(t.methods, cp.method) {
+			t.methods = append(t.methods, cp.method)
 		}
 	}
-	return parts
+	sort.Strings(t.methods)
+	for name, route := range r.names {
+		t.names[name] = routes[route]
+	}
+
+	noRoute, noMethod := engine.noRoute, engine.noMethod
+	if len(noRoute) == 0 {
+		noRoute = []HandlerFunc{notFound}
+	}
+	if len(noMethod) == 0 {
+		noMethod = []HandlerFunc{methodNotAllowed}
+	}
+	t.global = engine.combineHandlers(nil)
+	t.noRoute = engine.combineHandlers(noRoute)
+	t.noMethod = engine.combineHandlers(noMethod)
+	return t
 }
 
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	parts := parsePattern(pattern)
+// addRoute 注册路由，冲突时 panic 且不影响已有路由
+func (r *router) addRoute(route *Route) {
+	r.update(func() {
+		defer func() {
+			if err := recover(); err != nil {
+				// 插入到一半的节点（如可选片段展开后已插入的组合）会影响之后的注册，重新构建路由表
+				r.rebuild()
+				panic(err)
+			}
+		}()
+		r.table.insert(route)
+		r.routes = append(r.routes, route)
+	})
+}
 
-	key := method + "-" + pattern
-	_, ok := r.roots[method]
+// rebuild 用已注册的路由重新构建路由表，已注册的路由之间不会冲突
+func (r *router) rebuild() {
+	r.table = newTrie()
+	for _, route := range r.routes {
+		r.table.insert(route)
+	}
+}
+
+// removeRoute 删除 method、pattern 与 host 都相同的路由，返回是否找到
+func (r *router) removeRoute(method string, pattern string, host *hostPattern) bool {
+	removed := false
+	r.update(func() {
+		for i, route := range r.routes {
+			if route.method != method || route.pattern != pattern || route.group.host.String() != host.String() {
+				continue
+			}
+			r.routes = append(r.routes[:i:i], r.routes[i+1:]...)
+			if route.name != "" && r.names[route.name] == route {
+				delete(r.names, route.name)
+			}
+			removed = true
+			break
+		}
+		if !removed {
+			return
+		}
+		r.rebuild()
+	})
+	return removed
+}
 
-	if !ok {
-		r.roots[method] = &node{}
+// setName 为路由设置名称，同名只允许指向相同的路由模式（如 Any 注册的多个方法）
+func (r *router) setName(route *Route, name string) {
+	r.update(func() {
+		if old, ok := r.names[name]; ok && old.pattern != route.pattern {
+			panic(fmt.Sprintf("gee: route name '%s' for '%s' is already used by '%s'", name, route.pattern, old.pattern))
+		}
+		if route.name != "" && r.names[route.name] == route {
+			delete(r.names, route.name)
+		}
+		route.name = name
+		r.names[name] = route
+	})
+}
+
+// getRoute 在 Router 中查找匹配的路由，参数追加到 params
+func (t *routeTable) getRoute(method string, host string, path string, params *Params) *Route {
+	var route *Route
+	route, *params = t.router.Lookup(method, host, path, *params)
+	return route
+}
+
+// cleanPath 返回规范化的路径：以 / 开头，去掉 . 和 .. 以及重复的 /，保留末尾的 /
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// routingPath 返回用于匹配的路径：除 %2F 和 %25 外的转义都解码，
+// 这样参数值中的 / 不会被当作分隔符，而静态片段仍按解码后的形式匹配
+func routingPath(u *url.URL) string {
+	raw := u.EscapedPath()
+	if !strings.Contains(raw, "%") {
+		return raw
+	}
+	buf := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '%' && i+2 < len(raw) && isHex(raw[i+1]) && isHex(raw[i+2]) {
+			b := unhex(raw[i+1])<<4 | unhex(raw[i+2])
+			if b != '/' && b != '%' {
+				buf = append(buf, b)
+				i += 2
+				continue
+			}
+		}
+		buf = append(buf, raw[i])
 	}
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	return string(buf)
 }
 
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchParts := parsePattern(path)
-	params := make(map[string]string)
-	root, ok := r.roots[method]
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
 
-	if !ok {
-		return nil, nil
+// toggleSlash 去掉或补上末尾的 /
+func toggleSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
 	}
+	return p + "/"
+}
 
-	n := root.search(searchParts, 0)
+// redirectPath 根据 engine 的配置为未匹配的 p 寻找应当跳转到的已注册路径
+func (t *routeTable) redirectPath(method string, host string, p string, engine *Engine) (string, bool) {
+	params := make(Params, 0, t.maxParams)
+	if engine.RedirectTrailingSlash && p != "/" {
+		if alt := toggleSlash(p); t.getRoute(method, host, alt, &params) != nil {
+			return alt, true
+		}
+	}
+	if !engine.RedirectFixedPath {
+		return "", false
+	}
 
-	if n != nil {
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
-			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
-				break
+	candidates := []string{cleanPath(p)}
+	if engine.RedirectTrailingSlash && candidates[0] != "/" {
+		candidates = append(candidates, toggleSlash(candidates[0]))
+	}
+	for _, candidate := range candidates {
+		params = params[:0]
+		if candidate != p && t.getRoute(method, host, candidate, &params) != nil {
+			return candidate, true
+		}
+	}
+	// 忽略大小写的查找依赖路由树的结构，只有内置的 Router 支持
+	if tr, ok := t.router.(*trie); ok {
+		for _, candidate := range candidates {
+			if fixed, ok := tr.searchFold(method, host, candidate); ok {
+				return fixed, true
 			}
 		}
-		return n, params
 	}
-	return nil, nil
+	return "", false
 }
 
-func (r *router) getRoutes(method string) []*node {
-	root, ok := r.roots[method]
-	if !ok {
-		return nil
+// escapeTarget 转义 redirectPath 返回的路径，使参数中的 ?、# 和空格等不会改变跳转地址的含义。
+// raw 为 true 时路径来自 routingPath，其中的 % 都属于保留下来的 %2F 和 %25，转义后还原它们。
+// 开头连续的 / 合并为一个，否则 //evil.com/edit 会被当作跳转到其他站点的地址。
+func escapeTarget(p string, raw bool) string {
+	escaped := (&url.URL{Path: p}).EscapedPath()
+	if raw {
+		escaped = strings.ReplaceAll(escaped, "%25", "%")
+	}
+	if strings.HasPrefix(escaped, "//") {
+		escaped = "/" + strings.TrimLeft(escaped, "/")
 	}
+	return escaped
+}
 
-	nodes := make([]*node, 0)
-	root.travel(&nodes)
-	return nodes
+// redirect 永久跳转到 p 并保留查询字符串，p 需要已经转义，非 GET/HEAD 请求使用 308 以保留方法和请求体
+func redirect(c *Context, p string) {
+	code := http.StatusMovedPermanently
+	if c.Method != http.MethodGet && c.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+	if c.Req.URL.RawQuery != "" {
+		p += "?" + c.Req.URL.RawQuery
+	}
+	http.Redirect(c.Writer, c.Req, p, code)
+}
+
+// allowed 返回除 exclude 外能匹配 path 的所有方法，按字母序排列
+func (t *routeTable) allowed(host string, path string, exclude string) []string {
+	params := make(Params, 0, t.maxParams)
+	methods := make([]string, 0, len(t.methods))
+	for _, method := range t.methods {
+		if method == exclude {
+			continue
+		}
+		if t.getRoute(method, host, path, &params) != nil {
+			methods = append(methods, method)
+		}
+		params = params[:0]
+	}
+	return methods
+}
+
+// with 在全局中间件之后接上 handler，返回新的处理链
+func (t *routeTable) with(handler HandlerFunc) []HandlerFunc {
+	chain := make([]HandlerFunc, 0, len(t.global)+1)
+	return append(append(chain, t.global...), handler)
 }
 
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
-	if n != nil {
-		key := c.Method + "-" + n.pattern
-		c.Params = params
-		c.handlers = append(c.handlers, r.handlers[key])
-	} else {
-		c.handlers = append(c.handlers, func(c *Context) {
-			c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
-		})
+	t := r.load()
+	engine := c.engine
+	p, unescape := c.Path, false
+	if engine.UseRawPath {
+		p, unescape = routingPath(c.Req.URL), engine.UnescapePathValues
+	}
+
+	if cap(c.Params) < t.maxParams {
+		c.Params = make(Params, 0, t.maxParams)
+	}
+	if route := t.getRoute(c.Method, c.Req.Host, p, &c.Params); route != nil {
+		if unescape {
+			c.Params.unescape()
+		}
+		c.route = route
+		c.handlers = route.chain
+		c.Next()
+		return
+	}
+
+	if c.Method != http.MethodConnect && !engine.StrictRouting {
+		if target, ok := t.redirectPath(c.Method, c.Req.Host, p, engine); ok {
+			target = escapeTarget(target, engine.UseRawPath)
+			c.handlers = t.with(func(c *Context) {
+				redirect(c, target)
+			})
+			c.Next()
+			return
+		}
 	}
+	if c.Method == http.MethodOptions && engine.HandleOPTIONS {
+		if allow := t.allowed(c.Req.Host, p, http.MethodOptions); len(allow) > 0 {
+			allow = append(allow, http.MethodOptions)
+			c.handlers = t.with(func(c *Context) {
+				c.SetHeader("Allow", strings.Join(allow, ", "))
+				c.Status(http.StatusNoContent)
+			})
+			c.Next()
+			return
+		}
+	}
+	if engine.HandleMethodNotAllowed {
+		if allow := t.allowed(c.Req.Host, p, c.Method); len(allow) > 0 {
+			if engine.HandleOPTIONS && !slices.Contains(allow, http.MethodOptions) {
+				allow = append(allow, http.MethodOptions)
+			}
+			c.SetHeader("Allow", strings.Join(allow, ", "))
+			c.Writer.WriteHeader(http.StatusMethodNotAllowed)
+			c.handlers = t.noMethod
+			c.Next()
+			return
+		}
+	}
+	// 响应头推迟写出，先设置好状态码，只写响应体的 NoRoute/NoMethod 处理函数和中间件看到的都是 404/405
+	c.Writer.WriteHeader(http.StatusNotFound)
+	c.handlers = t.noRoute
 	c.Next()
 }
+
+func notFound(c *Context) {
+	c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
+}
+
+func methodNotAllowed(c *Context) {
+	c.String(http.StatusMethodNotAllowed, "405 METHOD NOT ALLOWED: %s %s\n", c.Method, c.Path)
+}
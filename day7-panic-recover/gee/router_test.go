@@ -0,0 +1,479 @@
+package gee
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 注册路由时的日志对测试没有意义
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func performRequest(engine *Engine, method string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestAllowHeaderListsOptionsOnce(t *testing.T) {
+	engine := New()
+	engine.HandleOPTIONS = true
+	engine.GET("/a", func(c *Context) {})
+	engine.OPTIONS("/a", func(c *Context) {})
+	engine.GET("/b", func(c *Context) {})
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/a", "GET, OPTIONS"},
+		{"/b", "GET, OPTIONS"},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, http.MethodPost, tt.path)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST %s: status = %d, want %d", tt.path, w.Code, http.StatusMethodNotAllowed)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("POST %s: Allow = %q, want %q", tt.path, got, tt.allow)
+		}
+	}
+}
+
+func TestFallbackHandlersDefaultStatus(t *testing.T) {
+	engine := New()
+	var logged int
+	engine.Use(func(c *Context) {
+		c.Next()
+		logged = c.Writer.Status()
+	})
+	engine.POST("/form", noop)
+	engine.NoRoute(func(c *Context) {
+		c.Writer.Write([]byte("missing"))
+	})
+	engine.NoMethod(func(c *Context) {
+		c.Writer.Write([]byte("wrong method"))
+	})
+
+	tests := []struct {
+		method string
+		target string
+		code   int
+	}{
+		{http.MethodGet, "/nothing", http.StatusNotFound},
+		{http.MethodGet, "/form", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, tt.method, tt.target)
+		if w.Code != tt.code || logged != tt.code {
+			t.Errorf("%s %s: status = %d, middleware saw %d, want %d", tt.method, tt.target, w.Code, logged, tt.code)
+		}
+	}
+
+	// 处理函数仍然可以改写状态码
+	engine.NoRoute(func(c *Context) {
+		c.String(http.StatusGone, "gone")
+	})
+	if w := performRequest(engine, http.MethodGet, "/nothing"); w.Code != http.StatusGone {
+		t.Errorf("GET /nothing: status = %d, want %d", w.Code, http.StatusGone)
+	}
+}
+
+// TestRegisterWhileServing 在处理请求的同时注册、删除路由，添加中间件并修改路由元数据，
+// 需要用 go test -race 运行才能发现数据竞争
+func TestRegisterWhileServing(t *testing.T) {
+	engine := New()
+	ping := engine.GET("/ping", func(c *Context) {
+		_ = c.Route().Meta["n"]
+		c.String(http.StatusOK, "pong")
+	})
+	engine.GET("/user/:id", noop)
+
+	const n = 200
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			pattern := "/dyn/" + strconv.Itoa(i)
+			engine.GET(pattern, noop)
+			if i%2 == 0 {
+				engine.RemoveRoute(http.MethodGet, pattern)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			engine.Use(func(c *Context) { c.Next() })
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			ping.Meta("n", i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			if w := performRequest(engine, http.MethodGet, "/ping"); w.Code != http.StatusOK {
+				t.Errorf("GET /ping: status = %d, want %d", w.Code, http.StatusOK)
+			}
+			performRequest(engine, http.MethodGet, "/user/"+strconv.Itoa(i))
+			performRequest(engine, http.MethodGet, "/dyn/"+strconv.Itoa(i))
+		}
+	}()
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		want := http.StatusOK
+		if i%2 == 0 {
+			want = http.StatusNotFound
+		}
+		if w := performRequest(engine, http.MethodGet, "/dyn/"+strconv.Itoa(i)); w.Code != want {
+			t.Errorf("GET /dyn/%d: status = %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestRedirectEscapesTarget(t *testing.T) {
+	tests := []struct {
+		useRawPath bool
+		target     string
+		location   string
+	}{
+		{false, "/f/a%3Fb/", "/f/a%3Fb"},
+		{false, "/f/x%20y/", "/f/x%20y"},
+		{false, "/f/a%23b/?q=1", "/f/a%23b?q=1"},
+		{false, "/f/%C3%A9/", "/f/%C3%A9"},
+		{true, "/f/a%3Fb/", "/f/a%3Fb"},
+		{true, "/f/a%2Fb%20c/", "/f/a%2Fb%20c"},
+		{true, "/f/50%25/", "/f/50%25"},
+		{false, "//evil.com/edit/", "/evil.com/edit"},
+		{false, "///evil.com/edit/", "/evil.com/edit"},
+		{true, "//evil.com/edit/", "/evil.com/edit"},
+	}
+	for _, tt := range tests {
+		engine := New()
+		engine.UseRawPath = tt.useRawPath
+		engine.GET("/f/:name", func(c *Context) {})
+		engine.GET("/*p/edit", func(c *Context) {})
+
+		w := performRequest(engine, http.MethodGet, tt.target)
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("GET %s (raw=%v): status = %d, want %d", tt.target, tt.useRawPath, w.Code, http.StatusMovedPermanently)
+		}
+		if got := w.Header().Get("Location"); got != tt.location {
+			t.Errorf("GET %s (raw=%v): Location = %q, want %q", tt.target, tt.useRawPath, got, tt.location)
+		}
+	}
+}
+
+func TestRedirectTargetKeepsParamValue(t *testing.T) {
+	engine := New()
+	engine.GET("/f/:name", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.Param("name"))
+	})
+	w := performRequest(engine, http.MethodGet, "/f/a%3Fb/")
+	w = performRequest(engine, http.MethodGet, w.Header().Get("Location"))
+	if w.Body.String() != "a?b" {
+		t.Errorf("param after redirect = %q, want %q", w.Body.String(), "a?b")
+	}
+}
+
+func noop(c *Context) {}
+
+// benchPatterns 是一组常见的 REST 路由，静态、参数和通配路由混合
+var benchPatterns = []string{
+	"/",
+	"/healthz",
+	"/user",
+	"/user/:id",
+	"/user/:id/posts",
+	"/user/:id/posts/:pid",
+	"/user/:id/posts/:pid/comments",
+	"/static/*filepath",
+	"/api/v1/orders",
+	"/api/v1/orders/:id",
+	"/api/v1/orders/:id/items/:item",
+}
+
+func newBenchEngine() *Engine {
+	engine := New()
+	for _, pattern := range benchPatterns {
+		engine.GET(pattern, noop)
+	}
+	return engine
+}
+
+func TestLookupDoesNotAllocate(t *testing.T) {
+	engine := newBenchEngine()
+	table := engine.router.load()
+	params := make(Params, 0, table.maxParams)
+	allocs := testing.AllocsPerRun(100, func() {
+		params = params[:0]
+		if table.getRoute(http.MethodGet, "", "/user/42/posts/7", &params) == nil {
+			t.Fatal("route not found")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("lookup of /user/:id/posts/:pid made %v allocations, want 0", allocs)
+	}
+	if got := params.ByName("pid"); got != "7" {
+		t.Errorf("pid = %q, want %q", got, "7")
+	}
+}
+
+func benchmarkLookup(b *testing.B, path string) {
+	engine := newBenchEngine()
+	table := engine.router.load()
+	params := make(Params, 0, table.maxParams)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		table.getRoute(http.MethodGet, "", path, &params)
+	}
+}
+
+func BenchmarkLookupStatic(b *testing.B)   { benchmarkLookup(b, "/api/v1/orders") }
+func BenchmarkLookupParam(b *testing.B)    { benchmarkLookup(b, "/user/42") }
+func BenchmarkLookupParams(b *testing.B)   { benchmarkLookup(b, "/user/42/posts/7") }
+func BenchmarkLookupCatchAll(b *testing.B) { benchmarkLookup(b, "/static/css/site/main.css") }
+func BenchmarkLookupNotFound(b *testing.B) { benchmarkLookup(b, "/user/42/unknown") }
+
+// BenchmarkStaticFastPath 在同一张混合路由表上比较先查 statics 再查路由树（statics）
+// 与只查路由树（tree）的耗时
+func BenchmarkStaticFastPath(b *testing.B) {
+	table := newBenchEngine().router.load()
+	withStatics := table.router.(*trie)
+	treeOnly := *withStatics
+	treeOnly.roots = map[string]*node{http.MethodGet: new(node)}
+	*treeOnly.roots[http.MethodGet] = *withStatics.roots[http.MethodGet]
+	treeOnly.roots[http.MethodGet].statics = nil
+	for _, path := range []string{"/healthz", "/api/v1/orders", "/user/42", "/user/42/posts/7", "/user/42/unknown"} {
+		for _, bc := range []struct {
+			name string
+			t    *trie
+		}{{"statics", withStatics}, {"tree", &treeOnly}} {
+			b.Run(bc.name+path, func(b *testing.B) {
+				params := make(Params, 0, table.maxParams)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					params = params[:0]
+					bc.t.getRoute(http.MethodGet, "", path, &params)
+				}
+			})
+		}
+	}
+}
+
+// discardWriter 丢弃响应，避免 httptest.ResponseRecorder 的分配影响结果
+type discardWriter struct{ header http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func BenchmarkServeHTTPParams(b *testing.B) {
+	engine := newBenchEngine()
+	req := httptest.NewRequest(http.MethodGet, "/user/42/posts/7", nil)
+	w := &discardWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ServeHTTP(w, req)
+	}
+}
+
+// segNode 和 segRouter 是替换为压缩前缀树之前按 / 拆分的前缀树，只用于对比基准测试
+type segNode struct {
+	pattern  string
+	part     string
+	children []*segNode
+	isWild   bool
+}
+
+func (n *segNode) insert(pattern string, parts []string, height int) {
+	if len(parts) == height {
+		n.pattern = pattern
+		return
+	}
+	part := parts[height]
+	for _, child := range n.children {
+		if child.part == part || child.isWild {
+			child.insert(pattern, parts, height+1)
+			return
+		}
+	}
+	child := &segNode{part: part, isWild: part[0] == ':' || part[0] == '*'}
+	n.children = append(n.children, child)
+	child.insert(pattern, parts, height+1)
+}
+
+func (n *segNode) search(parts []string, height int) *segNode {
+	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+		if n.pattern == "" {
+			return nil
+		}
+		return n
+	}
+	part := parts[height]
+	for _, child := range n.children {
+		if child.part == part || child.isWild {
+			if result := child.search(parts, height+1); result != nil {
+				return result
+			}
+		}
+	}
+	return nil
+}
+
+func segParts(pattern string) []string {
+	parts := make([]string, 0)
+	for _, item := range strings.Split(pattern, "/") {
+		if item != "" {
+			parts = append(parts, item)
+			if item[0] == '*' {
+				break
+			}
+		}
+	}
+	return parts
+}
+
+type segRouter struct {
+	roots map[string]*segNode
+}
+
+func (r *segRouter) getRoute(method string, path string) (*segNode, map[string]string) {
+	searchParts := segParts(path)
+	params := make(map[string]string)
+	root, ok := r.roots[method]
+	if !ok {
+		return nil, nil
+	}
+	n := root.search(searchParts, 0)
+	if n == nil {
+		return nil, nil
+	}
+	for index, part := range segParts(n.pattern) {
+		if part[0] == ':' {
+			params[part[1:]] = searchParts[index]
+		}
+		if part[0] == '*' && len(part) > 1 {
+			params[part[1:]] = strings.Join(searchParts[index:], "/")
+			break
+		}
+	}
+	return n, params
+}
+
+func benchmarkSegmentTrie(b *testing.B, path string) {
+	r := &segRouter{roots: map[string]*segNode{http.MethodGet: {}}}
+	for _, pattern := range benchPatterns {
+		r.roots[http.MethodGet].insert(pattern, segParts(pattern), 0)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.getRoute(http.MethodGet, path)
+	}
+}
+
+func BenchmarkSegmentTrieStatic(b *testing.B)   { benchmarkSegmentTrie(b, "/api/v1/orders") }
+func BenchmarkSegmentTrieParam(b *testing.B)    { benchmarkSegmentTrie(b, "/user/42") }
+func BenchmarkSegmentTrieParams(b *testing.B)   { benchmarkSegmentTrie(b, "/user/42/posts/7") }
+func BenchmarkSegmentTrieCatchAll(b *testing.B) { benchmarkSegmentTrie(b, "/static/css/site/main.css") }
+func BenchmarkSegmentTrieNotFound(b *testing.B) { benchmarkSegmentTrie(b, "/user/42/unknown") }
+
+// mapRouter 是只支持静态路径的 Router，用于测试自定义 Router 的接入
+type mapRouter struct {
+	routes []*Route
+	paths  map[string]*Route
+}
+
+func (r *mapRouter) Add(route *Route) {
+	r.routes = append(r.routes, route)
+	r.paths[route.Method()+" "+route.Pattern()] = route
+}
+
+func (r *mapRouter) Lookup(method string, host string, path string, params Params) (*Route, Params) {
+	return r.paths[method+" "+path], params
+}
+
+func (r *mapRouter) Routes() []RouteInfo {
+	infos := make([]RouteInfo, 0, len(r.routes))
+	for i := len(r.routes) - 1; i >= 0; i-- {
+		infos = append(infos, RouteInfo{Method: r.routes[i].Method(), Pattern: r.routes[i].Pattern()})
+	}
+	return infos
+}
+
+func TestCustomRouter(t *testing.T) {
+	engine := New()
+	engine.NewRouter = func() Router {
+		return &mapRouter{paths: make(map[string]*Route)}
+	}
+	engine.GET("/a", func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.Route().Pattern, c.GetString("mw"))
+	})
+	engine.POST("/b", noop)
+	// 在注册路由之后添加的中间件同样生效
+	engine.Use(func(c *Context) {
+		c.Set("mw", "yes")
+		c.Next()
+	})
+
+	if w := performRequest(engine, http.MethodGet, "/a"); w.Body.String() != "/a yes" {
+		t.Errorf("GET /a = %q, want %q", w.Body.String(), "/a yes")
+	}
+	if w := performRequest(engine, http.MethodGet, "/a/"); w.Header().Get("Location") != "/a" {
+		t.Errorf("GET /a/: Location = %q, want %q", w.Header().Get("Location"), "/a")
+	}
+	w := performRequest(engine, http.MethodGet, "/b")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("GET /b = %d with Allow %q, want %d with Allow %q", w.Code, w.Header().Get("Allow"), http.StatusMethodNotAllowed, "POST")
+	}
+	if w := performRequest(engine, http.MethodGet, "/c"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /c: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	// Engine.Routes 使用 mapRouter.Routes 的结果，它按注册的倒序返回
+	routes := engine.Routes()
+	if len(routes) != 2 || routes[0].Pattern != "/b" || routes[1].Pattern != "/a" {
+		t.Errorf("Routes() = %+v, want /b then /a", routes)
+	}
+}
+
+func TestContextRouteDoesNotAllocate(t *testing.T) {
+	engine := New()
+	var info RouteInfo
+	engine.Use(func(c *Context) {
+		info = c.Route()
+		c.Next()
+	})
+	engine.GET("/user/:id", noop).Name("user").Tags("users").Meta("auth", "admin")
+
+	req := httptest.NewRequest(http.MethodGet, "/user/42", nil)
+	w := &discardWriter{header: make(http.Header)}
+	engine.ServeHTTP(w, req)
+	allocs := testing.AllocsPerRun(100, func() {
+		engine.ServeHTTP(w, req)
+	})
+	if allocs != 0 {
+		t.Errorf("request reading Context.Route made %v allocations, want 0", allocs)
+	}
+	if info.Pattern != "/user/:id" || info.Name != "user" || info.Meta["auth"] != "admin" {
+		t.Errorf("Context.Route() = %+v", info)
+	}
+}
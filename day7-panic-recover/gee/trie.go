@@ -5,76 +5,480 @@ import (
 	"strings"
 )
 
+type nodeKind uint8
+
+const (
+	static   nodeKind = iota // 静态片段，如 /user/
+	param                    // 参数片段，如 :id
+	catchAll                 // 通配片段，如 *filepath
+)
+
+// node 是压缩前缀树（radix tree）的节点。
+// 静态节点保存压缩后的公共前缀，参数和通配节点保存完整的片段（如 :id），
+// 查找时直接在原始路径上按字节比较，不做 strings.Split。
 type node struct {
-	pattern  string
-	part     string
-	children []*node
-	isWild   bool
+	kind       nodeKind
+	part       string      // 静态节点的前缀，或通配片段本身
+	name       string      // 参数和通配节点的参数名
+	constraint *constraint // 参数节点的约束，为 nil 表示匹配任意非空片段
+	suffix     string      // 参数节点的固定后缀，如 :name.png 中的 .png
+	indices    string      // 静态子节点 part 的首字节，与 children 一一对应
+	children   []*node     // 静态子节点
+	params     []*node     // 参数子节点，带约束的排在前面
+	anyChild   *node
+	route      *Route        // 以该节点结尾的路由，为 nil 表示不是路由终点
+	statics    *staticRoutes // 只用于不限 host 的根节点，按完整路径索引不含通配符的路由
 }
 
 func (n *node) String() string {
-	return fmt.Sprintf("node{pattern=%s, part=%s, isWild=%t}", n.pattern, n.part, n.isWild)
+	pattern := ""
+	if n.route != nil {
+		pattern = n.route.pattern
+	}
+	return fmt.Sprintf("node{pattern=%s, part=%s, kind=%d}", pattern, n.part, n.kind)
 }
 
 func (n *node) travel(list *([]*node)) {
-	if n.pattern != "" {
+	if n.route != nil {
 		*list = append(*list, n)
 	}
 	for _, child := range n.children {
 		child.travel(list)
 	}
+	for _, child := range n.params {
+		child.travel(list)
+	}
+	if n.anyChild != nil {
+		n.anyChild.travel(list)
+	}
 }
 
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
+// firstPattern 返回以 n 为根的子树中注册的第一个路由，用于冲突提示
+func (n *node) firstPattern() string {
+	nodes := make([]*node, 0)
+	n.travel(&nodes)
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0].route.pattern
+}
+
+// longestPrefix 返回 a 和 b 的最长公共前缀长度
+func longestPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// insertStatic 沿静态子节点插入 part，必要时拆分已有节点，返回 part 结束处的节点
+func (n *node) insertStatic(part string) *node {
+	for part != "" {
+		i := strings.IndexByte(n.indices, part[0])
+		if i < 0 {
+			child := &node{kind: static, part: part}
+			n.indices += part[:1]
+			n.children = append(n.children, child)
 			return child
 		}
+
+		child := n.children[i]
+		l := longestPrefix(part, child.part)
+		if l < len(child.part) {
+			// 拆分：child 保留公共前缀，原有内容下移到新节点
+			rest := *child
+			rest.part = child.part[l:]
+			*child = node{
+				kind:     static,
+				part:     child.part[:l],
+				indices:  rest.part[:1],
+				children: []*node{&rest},
+			}
+		}
+		part = part[l:]
+		n = child
 	}
-	return nil
+	return n
 }
 
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
+// insertWild 插入参数或通配子节点。
+// 约束和后缀都相同的参数必须同名，否则无法区分；其余参数按 带后缀 > 带约束 > 普通 的顺序依次尝试。
+func (n *node) insertWild(pattern string, part string) *node {
+	w := parseWild(pattern, part)
+	child := &node{kind: param, part: part, name: w.name, constraint: w.constraint, suffix: w.suffix}
+	if part[0] == '*' {
+		child.kind = catchAll
+		if n.anyChild == nil {
+			n.anyChild = child
+		} else if n.anyChild.name != w.name {
+			panic(fmt.Sprintf("gee: wildcard '%s' in route '%s' conflicts with '%s' in existing route '%s'",
+				part, pattern, n.anyChild.part, n.anyChild.firstPattern()))
+		}
+		return n.anyChild
+	}
+
+	for _, p := range n.params {
+		if p.constraint.String() != w.constraint.String() || p.suffix != w.suffix {
+			continue
 		}
+		if p.name != w.name {
+			panic(fmt.Sprintf("gee: wildcard '%s' in route '%s' conflicts with '%s' in existing route '%s'",
+				part, pattern, p.part, p.firstPattern()))
+		}
+		return p
+	}
+	i := 0
+	for i < len(n.params) && !child.before(n.params[i]) {
+		i++
 	}
-	return nodes
+	n.params = append(n.params, nil)
+	copy(n.params[i+1:], n.params[i:])
+	n.params[i] = child
+	return child
 }
 
-func (n *node) insert(pattern string, parts []string, height int) {
-	if len(parts) == height {
-		n.pattern = pattern
-		return
+// before 判断参数节点 n 是否应排在 p 之前尝试：后缀越长越具体，其次是带约束的
+func (n *node) before(p *node) bool {
+	if len(n.suffix) != len(p.suffix) {
+		return len(n.suffix) > len(p.suffix)
 	}
+	return n.constraint != nil && p.constraint == nil
+}
 
-	part := parts[height]
-	child := n.matchChild(part)
-	if child == nil {
-		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
-		n.children = append(n.children, child)
+// value 从路径片段中取出参数值：去掉后缀并检查约束，fold 为 true 时后缀忽略大小写
+func (n *node) value(segment string, fold bool) (string, bool) {
+	if len(segment) <= len(n.suffix) {
+		return "", false
+	}
+	value, suffix := segment[:len(segment)-len(n.suffix)], segment[len(segment)-len(n.suffix):]
+	if suffix != n.suffix && !(fold && strings.EqualFold(suffix, n.suffix)) {
+		return "", false
+	}
+	if n.constraint != nil && !n.constraint.match(value) {
+		return "", false
 	}
-	child.insert(pattern, parts, height+1)
+	return value, true
 }
 
-func (n *node) search(parts []string, height int) *node {
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
-		if n.pattern == "" {
+// insert 插入路由，遇到无法区分的路由时直接 panic，让错误在启动时暴露
+func (n *node) insert(route *Route, parts []string) {
+	for _, part := range parts {
+		if isWild(part) {
+			n = n.insertWild(route.pattern, part)
+		} else {
+			n = n.insertStatic(part)
+		}
+	}
+	if n.route != nil {
+		panic(fmt.Sprintf("gee: route '%s' conflicts with existing route '%s'", route.pattern, n.route.pattern))
+	}
+	n.route = route
+}
+
+// search 在 n 的子节点中匹配剩余路径 path，按 静态 > 参数 > 通配 的顺序回溯。
+// 参数值直接截取自 path 并追加到 params，params 容量足够时查找不分配内存。
+func (n *node) search(path string, params *Params) *node {
+	if path == "" {
+		if n.route == nil {
 			return nil
 		}
 		return n
 	}
 
-	part := parts[height]
-	children := n.matchChildren(part)
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.part) {
+			if result := child.search(path[len(child.part):], params); result != nil {
+				return result
+			}
+		}
+	}
+
+	if len(n.params) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		for _, child := range n.params {
+			value, ok := child.value(path[:end], false)
+			if !ok {
+				continue
+			}
+			*params = append(*params, Param{Key: child.name, Value: value})
+			if result := child.search(path[end:], params); result != nil {
+				return result
+			}
+			*params = (*params)[:len(*params)-1]
+		}
+	}
+
+	child := n.anyChild
+	if child == nil {
+		return nil
+	}
+	// 通配片段后还有内容时（如 /files/*path/download），从最长的取值开始尝试
+	if len(child.children) > 0 {
+		for end := strings.LastIndexByte(path, '/'); end > 0; end = strings.LastIndexByte(path[:end], '/') {
+			*params = append(*params, Param{Key: child.name, Value: path[:end]})
+			if result := child.search(path[end:], params); result != nil {
+				return result
+			}
+			*params = (*params)[:len(*params)-1]
+		}
+	}
+	if child.route != nil {
+		if child.name != "" {
+			*params = append(*params, Param{Key: child.name, Value: path})
+		}
+		return child
+	}
+	return nil
+}
+
+// searchFold 与 search 相同，但静态片段忽略大小写，
+// 返回把静态片段替换为注册时大小写后的路径，追加在 buf 之后，未匹配时返回 nil
+func (n *node) searchFold(path string, buf []byte) []byte {
+	if path == "" {
+		if n.route == nil {
+			return nil
+		}
+		return buf
+	}
+
+	for _, child := range n.children {
+		if len(path) >= len(child.part) && strings.EqualFold(path[:len(child.part)], child.part) {
+			if result := child.searchFold(path[len(child.part):], append(buf, child.part...)); result != nil {
+				return result
+			}
+		}
+	}
+
+	if len(n.params) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		for _, child := range n.params {
+			value, ok := child.value(path[:end], true)
+			if !ok {
+				continue
+			}
+			if result := child.searchFold(path[end:], append(append(buf, value...), child.suffix...)); result != nil {
+				return result
+			}
+		}
+	}
 
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
-			return result
+	child := n.anyChild
+	if child == nil {
+		return nil
+	}
+	if len(child.children) > 0 {
+		for end := strings.LastIndexByte(path, '/'); end > 0; end = strings.LastIndexByte(path[:end], '/') {
+			if result := child.searchFold(path[end:], append(buf, path[:end]...)); result != nil {
+				return result
+			}
 		}
 	}
+	if child.route != nil {
+		return append(buf, path...)
+	}
 	return nil
 }
+
+// trie 是内置的 Router 实现：按方法划分的压缩前缀树，限定 host 的路由按 host 模式分组。
+// 不限 host 且不含通配符的路由另外在根节点的 statics 中按路径索引，查找时先于路由树，
+// 与路由树共用一次按方法的 map 查找。
+type trie struct {
+	roots     map[string]*node // 不限 host 的路由树，按方法划分
+	hosts     []*hostRoots     // 限定 host 的路由树，精确 host 排在带 {name} 的前面
+	routes    []*Route         // 按注册顺序保存的全部路由
+	maxParams int              // 所有路由中通配符数量的最大值，用于预分配 Params
+}
+
+// staticRoutes 按完整路径索引某个方法下不含通配符的路由。
+// lens 按对 64 取余记录已有路径的长度，lasts 记录已有路径的末字节，两者有一个对不上的路径
+// 不必计算哈希，避免带参数的请求为一次注定落空的 map 查找付出代价。
+type staticRoutes struct {
+	routes map[string]*Route
+	lens   uint64
+	lasts  [4]uint64
+}
+
+func (s *staticRoutes) add(path string, route *Route) {
+	s.routes[path] = route
+	s.lens |= 1 << (len(path) & 63)
+	last := path[len(path)-1]
+	s.lasts[last>>6] |= 1 << (last & 63)
+}
+
+// get 返回 path 对应的静态路由
+func (s *staticRoutes) get(path string) *Route {
+	if s == nil || path == "" || s.lens&(1<<(len(path)&63)) == 0 {
+		return nil
+	}
+	if last := path[len(path)-1]; s.lasts[last>>6]&(1<<(last&63)) == 0 {
+		return nil
+	}
+	return s.routes[path]
+}
+
+// hostRoots 是某个 host 模式下按方法划分的路由树
+type hostRoots struct {
+	host  *hostPattern
+	roots map[string]*node
+}
+
+var _ Router = (*trie)(nil)
+
+// NewTrieRouter 返回内置前缀树实现的 Router，是 Engine.NewRouter 的默认值，
+// 也可以作为自定义 Router 的回退实现
+func NewTrieRouter() Router {
+	return newTrie()
+}
+
+func newTrie() *trie {
+	return &trie{roots: make(map[string]*node)}
+}
+
+func (t *trie) Add(route *Route) {
+	t.insert(route)
+	t.routes = append(t.routes, route)
+}
+
+func (t *trie) Lookup(method string, host string, path string, params Params) (*Route, Params) {
+	route := t.getRoute(method, host, path, &params)
+	return route, params
+}
+
+func (t *trie) Routes() []RouteInfo {
+	infos := make([]RouteInfo, 0, len(t.routes))
+	for _, route := range t.routes {
+		infos = append(infos, route.info)
+	}
+	return infos
+}
+
+// insert 插入路由，可选片段展开后的每种组合都指向同一条路由。
+// 冲突时 panic，路由表中可能留下插入到一半的节点，由调用方重新构建。
+func (t *trie) insert(route *Route) {
+	parts := parsePattern(route.pattern)
+	validatePattern(route.pattern, parts)
+
+	roots := t.roots
+	count := 0
+	if host := route.group.host; host != nil {
+		roots = t.hostRoots(host)
+		count = host.captures()
+	}
+	_, ok := roots[route.method]
+	if !ok {
+		roots[route.method] = &node{}
+	}
+
+	variants := expandOptional(route.pattern, parts)
+	for _, variant := range variants {
+		roots[route.method].insert(route, variant)
+	}
+	if route.group.host == nil {
+		for _, variant := range variants {
+			if len(variant) == 1 && !isWild(variant[0]) {
+				t.addStatic(route, variant[0])
+			}
+		}
+	}
+
+	for _, part := range parts {
+		if isWild(part) {
+			count++
+		}
+	}
+	if count > t.maxParams {
+		t.maxParams = count
+	}
+}
+
+// addStatic 把不含通配符的路径加入根节点的 statics。
+// 路由树中静态片段优先于参数，所以完整的静态路径一定匹配到这条路由，两者结果一致。
+func (t *trie) addStatic(route *Route, path string) {
+	root := t.roots[route.method]
+	if root.statics == nil {
+		root.statics = &staticRoutes{routes: make(map[string]*Route)}
+	}
+	root.statics.add(path, route)
+}
+
+// hostRoots 返回 host 模式对应的路由树，不存在时新建
+func (t *trie) hostRoots(host *hostPattern) map[string]*node {
+	for _, h := range t.hosts {
+		if h.host.raw == host.raw {
+			return h.roots
+		}
+	}
+	h := &hostRoots{host: host, roots: make(map[string]*node)}
+	i := len(t.hosts)
+	if !host.wildcard {
+		for i > 0 && t.hosts[i-1].host.wildcard {
+			i--
+		}
+	}
+	t.hosts = append(t.hosts, nil)
+	copy(t.hosts[i+1:], t.hosts[i:])
+	t.hosts[i] = h
+	return h.roots
+}
+
+// rootsFor 返回请求 host 可以使用的所有路由树，按匹配优先级排列
+func (t *trie) rootsFor(host string) []map[string]*node {
+	list := make([]map[string]*node, 0, len(t.hosts)+1)
+	for _, h := range t.hosts {
+		if h.host.match(host, nil) {
+			list = append(list, h.roots)
+		}
+	}
+	return append(list, t.roots)
+}
+
+// getRoute 查找匹配的路由，先按 host 选择路由树再匹配路径，参数写入 params。
+// params 预留 maxParams 的容量时整个查找过程没有堆分配。
+func (t *trie) getRoute(method string, host string, path string, params *Params) *Route {
+	for _, h := range t.hosts {
+		mark := len(*params)
+		if !h.host.match(host, params) {
+			continue
+		}
+		if root, ok := h.roots[method]; ok {
+			if n := root.search(path, params); n != nil {
+				return n.route
+			}
+		}
+		*params = (*params)[:mark]
+	}
+
+	root, ok := t.roots[method]
+	if !ok {
+		return nil
+	}
+	if route := root.statics.get(path); route != nil {
+		return route
+	}
+	if n := root.search(path, params); n != nil {
+		return n.route
+	}
+	return nil
+}
+
+// searchFold 在 host 可用的路由树中忽略大小写查找 path，返回注册时大小写的路径
+func (t *trie) searchFold(method string, host string, path string) (string, bool) {
+	for _, roots := range t.rootsFor(host) {
+		root, ok := roots[method]
+		if !ok {
+			continue
+		}
+		if fixed := root.searchFold(path, make([]byte, 0, len(path))); fixed != nil {
+			return string(fixed), true
+		}
+	}
+	return "", false
+}
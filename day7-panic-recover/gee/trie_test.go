@@ -0,0 +1,158 @@
+package gee
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newPatternEngine 注册 patterns，每个处理函数返回匹配到的路由模式和参数
+func newPatternEngine(patterns ...string) *Engine {
+	engine := New()
+	for _, pattern := range patterns {
+		pattern := pattern
+		engine.GET(pattern, func(c *Context) {
+			c.String(http.StatusOK, "%s %s", pattern, formatParams(c.Params))
+		})
+	}
+	return engine
+}
+
+func formatParams(ps Params) string {
+	pairs := make([]string, 0, len(ps))
+	for _, p := range ps {
+		pairs = append(pairs, p.Key+"="+p.Value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func TestPatternMatching(t *testing.T) {
+	engine := newPatternEngine(
+		"/files/*path/download",
+		"/files/*path",
+		"/docs/:lang?/intro",
+		"/img/:name.png",
+		"/img/:name.tar.gz",
+		"/img/:name",
+		"/img/{id:[0-9]+}.jpg",
+		"/v/:id<int>?",
+		"/:lang?/home",
+	)
+
+	tests := []struct {
+		path string
+		want string // 路由模式和参数，空字符串表示 404
+	}{
+		// 通配片段后还有内容时从最长的取值开始尝试
+		{"/files/a/b/download", "/files/*path/download path=a/b"},
+		{"/files/a/download/download", "/files/*path/download path=a/download"},
+		{"/files/download", "/files/*path path=download"},
+		{"/files/a/b/c", "/files/*path path=a/b/c"},
+		// 可选片段
+		{"/docs/en/intro", "/docs/:lang?/intro lang=en"},
+		{"/docs/intro", "/docs/:lang?/intro "},
+		{"/docs/en/fr/intro", ""},
+		{"/v/3", "/v/:id<int>? id=3"},
+		{"/v", "/v/:id<int>? "},
+		{"/v/x", ""},
+		{"/home", "/:lang?/home "},
+		{"/de/home", "/:lang?/home lang=de"},
+		// 后缀越长越优先，其次是带约束的，最后是普通参数
+		{"/img/cat.png", "/img/:name.png name=cat"},
+		{"/img/cat.tar.gz", "/img/:name.tar.gz name=cat"},
+		{"/img/cat.gif", "/img/:name name=cat.gif"},
+		{"/img/.png", "/img/:name name=.png"},
+		{"/img/12.jpg", "/img/{id:[0-9]+}.jpg id=12"},
+		{"/img/ab.jpg", "/img/:name name=ab.jpg"},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, http.MethodGet, tt.path)
+		got := ""
+		if w.Code == http.StatusOK {
+			got = w.Body.String()
+		}
+		if got != tt.want {
+			t.Errorf("GET %s = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPatternURL(t *testing.T) {
+	engine := New()
+	engine.GET("/files/*path/download", noop).Name("download")
+	engine.GET("/docs/:lang?/intro", noop).Name("intro")
+	engine.GET("/:lang?/home", noop).Name("home")
+	engine.GET("/img/:name.png", noop).Name("png")
+
+	tests := []struct {
+		name  string
+		pairs []interface{}
+		want  string
+	}{
+		{"download", []interface{}{"path", "a/b c"}, "/files/a/b%20c/download"},
+		{"intro", nil, "/docs/intro"},
+		{"intro", []interface{}{"lang", "fr"}, "/docs/fr/intro"},
+		{"home", nil, "/home"},
+		{"home", []interface{}{"lang", "de"}, "/de/home"},
+		{"png", []interface{}{"name", "cat"}, "/img/cat.png"},
+	}
+	for _, tt := range tests {
+		got, err := engine.URL(tt.name, tt.pairs...)
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v) = %q, %v, want %q", tt.name, tt.pairs, got, err, tt.want)
+		}
+	}
+}
+
+func TestPatternConflicts(t *testing.T) {
+	tests := []struct {
+		existing []string
+		pattern  string
+		panic    string
+	}{
+		{[]string{"/a/:id"}, "/a/:id", "conflicts with existing route '/a/:id'"},
+		{[]string{"/a/:id"}, "/a/:name", "wildcard ':name' in route '/a/:name' conflicts with ':id'"},
+		{[]string{"/a/:id<int>"}, "/a/:num<int>", "conflicts with ':id<int>'"},
+		{[]string{"/img/:name.png"}, "/img/:file.png", "conflicts with ':name.png'"},
+		{[]string{"/f/*path"}, "/f/*file", "conflicts with '*path'"},
+		{[]string{"/f/*path/download"}, "/f/*file/download", "conflicts with '*path'"},
+		{[]string{"/docs/intro"}, "/docs/:lang?/intro", "route '/docs/:lang?/intro' conflicts with existing route '/docs/intro'"},
+		{nil, "/a/:", "must be named"},
+		{nil, "/a/*/b", "must be named"},
+	}
+	for _, tt := range tests {
+		engine := newPatternEngine(tt.existing...)
+		got := func() (msg string) {
+			defer func() {
+				msg = fmt.Sprint(recover())
+			}()
+			engine.GET(tt.pattern, noop)
+			return ""
+		}()
+		if !strings.Contains(got, tt.panic) {
+			t.Errorf("GET(%q) after %v panicked with %q, want it to contain %q", tt.pattern, tt.existing, got, tt.panic)
+		}
+	}
+}
+
+// 注册失败时插入到一半的节点要清理掉，不影响之后注册同一位置的其他参数名
+func TestOptionalConflictRollsBack(t *testing.T) {
+	engine := newPatternEngine("/w")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("GET /w/:x? did not panic")
+			}
+		}()
+		engine.GET("/w/:x?", noop)
+	}()
+
+	if w := performRequest(engine, http.MethodGet, "/w/1"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /w/1 after failed registration: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := performRequest(engine, http.MethodGet, "/w"); w.Body.String() != "/w " {
+		t.Errorf("GET /w = %q, want %q", w.Body.String(), "/w ")
+	}
+	engine.GET("/w/:y", noop)
+}